@@ -27,7 +27,39 @@
 //
 // https://www.flickr.com/photos/shibukawa/24644611414/
 //
-// Restrictions
+// Pipe() connects two *Conn instances to each other, like net.Pipe, for
+// tests that want a live duplex connection instead of (or in addition to)
+// a fully scripted scenario.
 //
-// Now timeout functions are not implemented. You can test timeout scenarios.
+// ReadFrame()/WriteFrame() let a scenario assert on message-framed
+// protocols (length-prefixed, newline-delimited, null-terminated, ...)
+// at the payload level instead of hand-encoding the wire bytes; see
+// FrameCodec.
+//
+// WriteMatch() accepts a WriteMatcher instead of a literal expectation,
+// for payloads that aren't byte-for-byte deterministic (timestamps,
+// nonces, ...); see MatchRegexp, MatchPrefix, MatchJSON,
+// MatchHTTPRequest and MatchAny.
+//
+// NewListener() returns a mock net.Listener whose Accept() hands out
+// pre-configured *Conn instances (or errors) in order, for testing
+// server code built on http.Serve or a custom Accept loop.
+//
+// NewPacket() returns a *PacketConn implementing net.PacketConn (and
+// net.Conn) for datagram-oriented protocols such as UDP/DTLS/QUIC. It is
+// scripted with ReadFrom()/WriteTo() actions instead of Read()/Write():
+// each action is exactly one datagram, and a short read buffer truncates
+// the rest of it rather than carrying it over to the next call.
+//
+// Record() wraps a live net.Conn, journaling the bytes of every Read/Write
+// call that moves any, and every Close call, as it forwards them. The journal can be written out with Save and read
+// back with Load to get an []Action for SetExpectedActions, turning one
+// recorded session into a hermetic replay test.
+//
+// Deadlines
+//
+// SetDeadline, SetReadDeadline and SetWriteDeadline behave like their
+// net.Conn counterparts: once a deadline passes, Read/Write return an
+// error whose Timeout() method returns true, and a zero time.Time clears
+// the deadline.
 package mockconn
@@ -0,0 +1,137 @@
+package mockconn
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// FrameCodec encodes and decodes a single message of a framed protocol,
+// such as a length-prefixed or delimiter-based wire format.
+type FrameCodec interface {
+	// Encode turns payload into the bytes that go on the wire for a
+	// single message, including any header or delimiter.
+	Encode(payload []byte) []byte
+	// Decode reads a single message from r and returns its payload.
+	// It returns io.EOF or io.ErrUnexpectedEOF when r does not yet
+	// contain a full message.
+	Decode(r io.Reader) ([]byte, error)
+}
+
+type frameWriteAction struct {
+	codec   FrameCodec
+	payload []byte
+	buffer  []byte
+}
+
+func (f frameWriteAction) Type() ActionType {
+	return WriteFrameActionType
+}
+
+// ReadFrame creates an action to read a single message, encoding payload
+// with codec before it is handed out through Read().
+func ReadFrame(codec FrameCodec, payload []byte) Action {
+	data := codec.Encode(payload)
+	return &readAction{
+		data:     data,
+		original: data,
+		scripted: true,
+	}
+}
+
+// WriteFrame creates an action that decodes incoming bytes with codec and
+// compares the decoded payload against payload, rather than comparing
+// wire bytes directly. This lets a scenario assert on message content
+// without hand-encoding headers or delimiters.
+func WriteFrame(codec FrameCodec, payload []byte) Action {
+	return &frameWriteAction{
+		codec:   codec,
+		payload: payload,
+	}
+}
+
+// LengthPrefixCodec frames messages with a fixed-length, big-endian byte
+// count ahead of the payload, as used by many game and RPC protocols.
+// HeadLength must be 2 (uint16 header) or 4 (uint32 header).
+type LengthPrefixCodec struct {
+	HeadLength int
+}
+
+// Encode implements FrameCodec.
+func (c LengthPrefixCodec) Encode(payload []byte) []byte {
+	buf := make([]byte, c.HeadLength+len(payload))
+	switch c.HeadLength {
+	case 2:
+		binary.BigEndian.PutUint16(buf, uint16(len(payload)))
+	case 4:
+		binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	default:
+		panic("mockconn: LengthPrefixCodec.HeadLength must be 2 or 4")
+	}
+	copy(buf[c.HeadLength:], payload)
+	return buf
+}
+
+// Decode implements FrameCodec.
+func (c LengthPrefixCodec) Decode(r io.Reader) ([]byte, error) {
+	head := make([]byte, c.HeadLength)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	var length int
+	switch c.HeadLength {
+	case 2:
+		length = int(binary.BigEndian.Uint16(head))
+	case 4:
+		length = int(binary.BigEndian.Uint32(head))
+	default:
+		panic("mockconn: LengthPrefixCodec.HeadLength must be 2 or 4")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+var (
+	// Uint16LengthCodec frames messages with a 2-byte big-endian length prefix.
+	Uint16LengthCodec FrameCodec = LengthPrefixCodec{HeadLength: 2}
+	// Uint32LengthCodec frames messages with a 4-byte big-endian length prefix.
+	Uint32LengthCodec FrameCodec = LengthPrefixCodec{HeadLength: 4}
+)
+
+// delimiterCodec frames messages by appending delim after the payload and
+// reading up to (and stripping) delim on decode.
+type delimiterCodec struct {
+	delim byte
+}
+
+// Encode implements FrameCodec.
+func (c delimiterCodec) Encode(payload []byte) []byte {
+	buf := make([]byte, len(payload)+1)
+	copy(buf, payload)
+	buf[len(payload)] = c.delim
+	return buf
+}
+
+// Decode implements FrameCodec.
+func (c delimiterCodec) Decode(r io.Reader) ([]byte, error) {
+	var payload []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if b[0] == c.delim {
+			return payload, nil
+		}
+		payload = append(payload, b[0])
+	}
+}
+
+var (
+	// NewlineCodec frames messages as text terminated by '\n'.
+	NewlineCodec FrameCodec = delimiterCodec{delim: '\n'}
+	// NullTerminatedCodec frames messages as bytes terminated by a NUL byte.
+	NullTerminatedCodec FrameCodec = delimiterCodec{delim: 0}
+)
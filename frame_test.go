@@ -0,0 +1,79 @@
+package mockconn
+
+import "testing"
+
+func TestWriteFrameUint16(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		WriteFrame(Uint16LengthCodec, []byte("hello")),
+		Close(),
+	)
+	encoded := Uint16LengthCodec.Encode([]byte("hello"))
+	n, err := mock.Write(encoded)
+	if n != len(encoded) {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	mock.Close()
+	errors := mock.Verify()
+	if len(errors) != 0 {
+		t.Errorf("mock shouldn't have any errors, but %d", len(errors))
+		for i, err := range errors {
+			t.Log(i+1, err.Error())
+		}
+	}
+}
+
+func TestWriteFramePartialChunks(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		WriteFrame(Uint32LengthCodec, []byte("hello world")),
+		Close(),
+	)
+	encoded := Uint32LengthCodec.Encode([]byte("hello world"))
+	mock.Write(encoded[:3])
+	n, err := mock.Write(encoded[3:])
+	if n != len(encoded[3:]) {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	mock.Close()
+	errors := mock.Verify()
+	if len(errors) != 0 {
+		t.Errorf("mock shouldn't have any errors, but %d", len(errors))
+		for i, err := range errors {
+			t.Log(i+1, err.Error())
+		}
+	}
+}
+
+func TestWriteFrameMismatch(t *testing.T) {
+	mock := New(nil)
+	mock.SetExpectedActions(
+		WriteFrame(NewlineCodec, []byte("hello")),
+	)
+	_, err := mock.Write(NewlineCodec.Encode([]byte("world")))
+	if err == nil {
+		t.Error("err should not be nil")
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		ReadFrame(NullTerminatedCodec, []byte("hello")),
+	)
+	buffer := make([]byte, 100)
+	n, err := mock.Read(buffer)
+	expected := NullTerminatedCodec.Encode([]byte("hello"))
+	if string(buffer[:n]) != string(expected) {
+		t.Errorf("Read result: %q", buffer[:n])
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+}
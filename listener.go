@@ -0,0 +1,117 @@
+package mockconn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+// Listener is a mock object that has the net.Listener interface. Accept()
+// hands out the *Conn instances given to SetExpectedConnections, in
+// order, so code built on http.Serve(l, handler) or a custom Accept loop
+// can be tested without opening a real socket.
+type Listener struct {
+	t    *testing.T
+	mu   sync.Mutex
+	addr net.Addr
+
+	conns     []*Conn
+	current   int
+	acceptErr error
+	closed    bool
+	changed   chan struct{}
+}
+
+// NewListener creates a mock net.Listener.
+//
+// t is kept for parity with New and future diagnostics; Accept() simply
+// blocks, like a real listener, once every scripted connection and error
+// has been handed out.
+func NewListener(t *testing.T) *Listener {
+	return &Listener{
+		t:       t,
+		addr:    &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9000},
+		changed: make(chan struct{}),
+	}
+}
+
+// SetAddr sets the address returned by Addr().
+func (l *Listener) SetAddr(addr net.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.addr = addr
+}
+
+// SetExpectedConnections sets the *Conn instances Accept() hands out, in
+// order. It wakes any call already blocked in Accept().
+func (l *Listener) SetExpectedConnections(conns ...*Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns = conns
+	l.broadcastLocked()
+}
+
+// ExpectAcceptError makes the next Accept() call return err instead of a
+// connection. It wakes any call already blocked in Accept().
+func (l *Listener) ExpectAcceptError(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acceptErr = err
+	l.broadcastLocked()
+}
+
+// broadcastLocked wakes every goroutine blocked in Accept waiting on
+// l.changed. Callers must hold l.mu.
+func (l *Listener) broadcastLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Accept waits for the next scripted connection or error. It blocks if
+// none is available yet, and returns a *net.OpError wrapping
+// net.ErrClosed once Close() is called, unblocking any pending call.
+func (l *Listener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	for {
+		if l.closed {
+			l.mu.Unlock()
+			return nil, &net.OpError{Op: "accept", Net: "mock", Addr: l.addr, Err: net.ErrClosed}
+		}
+		if l.acceptErr != nil {
+			err := l.acceptErr
+			l.acceptErr = nil
+			l.mu.Unlock()
+			return nil, err
+		}
+		if l.current < len(l.conns) {
+			conn := l.conns[l.current]
+			l.current++
+			l.mu.Unlock()
+			return conn, nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		<-changed
+		l.mu.Lock()
+	}
+}
+
+// Close closes the listener, unblocking any pending Accept() call.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("already closed")
+	}
+	l.closed = true
+	l.broadcastLocked()
+	return nil
+}
+
+// Addr returns the listener's network address.
+func (l *Listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.addr
+}
@@ -0,0 +1,89 @@
+package mockconn
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestListenerAcceptInOrder(t *testing.T) {
+	conn1 := New(t)
+	conn2 := New(t)
+	listener := NewListener(t)
+	listener.SetExpectedConnections(conn1, conn2)
+
+	var l net.Listener = listener
+	got1, err := l.Accept()
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	if got1 != conn1 {
+		t.Error("Accept should return conn1 first")
+	}
+	got2, err := l.Accept()
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	if got2 != conn2 {
+		t.Error("Accept should return conn2 second")
+	}
+}
+
+func TestListenerAcceptError(t *testing.T) {
+	listener := NewListener(t)
+	wantErr := errors.New("boom")
+	listener.ExpectAcceptError(wantErr)
+
+	_, err := listener.Accept()
+	if err != wantErr {
+		t.Errorf("err should be %v, but %v", wantErr, err)
+	}
+}
+
+func TestListenerSetExpectedConnectionsUnblocksAccept(t *testing.T) {
+	listener := NewListener(t)
+	conn := New(t)
+	done := make(chan net.Conn, 1)
+	go func() {
+		got, _ := listener.Accept()
+		done <- got
+	}()
+
+	listener.SetExpectedConnections(conn)
+
+	if got := <-done; got != conn {
+		t.Error("Accept should return conn once it's registered")
+	}
+}
+
+func TestListenerExpectAcceptErrorUnblocksAccept(t *testing.T) {
+	listener := NewListener(t)
+	wantErr := errors.New("boom")
+	done := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept()
+		done <- err
+	}()
+
+	listener.ExpectAcceptError(wantErr)
+
+	if err := <-done; err != wantErr {
+		t.Errorf("err should be %v, but %v", wantErr, err)
+	}
+}
+
+func TestListenerCloseUnblocksAccept(t *testing.T) {
+	listener := NewListener(t)
+	done := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept()
+		done <- err
+	}()
+
+	listener.Close()
+
+	err := <-done
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("err should wrap net.ErrClosed, but %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package mockconn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+)
+
+// WriteMatcher validates bytes written through Write() against a
+// non-literal expectation, for payloads that contain timestamps, nonces
+// or other values that can't be pinned down to an exact byte sequence.
+//
+// Match is called with every byte written to the action so far. It
+// returns the number of bytes the matcher has decided about: 0 means
+// "not enough data yet, call me again once more arrives". A non-nil
+// error means the bytes seen so far can never satisfy the matcher.
+type WriteMatcher interface {
+	Match(actual []byte) (consumed int, err error)
+	String() string
+}
+
+type matchWriteAction struct {
+	matcher WriteMatcher
+	buffer  []byte
+}
+
+func (m matchWriteAction) Type() ActionType {
+	return WriteMatchActionType
+}
+
+// WriteMatch creates an action that hands every written byte to matcher
+// instead of comparing against a literal expectation.
+func WriteMatch(matcher WriteMatcher) Action {
+	return &matchWriteAction{matcher: matcher}
+}
+
+type anyMatcher struct {
+	n int
+}
+
+// Match implements WriteMatcher.
+func (m anyMatcher) Match(actual []byte) (int, error) {
+	if len(actual) < m.n {
+		return 0, nil
+	}
+	return m.n, nil
+}
+
+func (m anyMatcher) String() string {
+	return fmt.Sprintf("any %d byte(s)", m.n)
+}
+
+// MatchAny accepts any n bytes, without looking at their content.
+func MatchAny(n int) WriteMatcher {
+	return anyMatcher{n: n}
+}
+
+type prefixMatcher struct {
+	prefix []byte
+}
+
+// Match implements WriteMatcher.
+func (m prefixMatcher) Match(actual []byte) (int, error) {
+	if len(actual) < len(m.prefix) {
+		return 0, nil
+	}
+	if !bytes.HasPrefix(actual, m.prefix) {
+		return 0, fmt.Errorf("expected prefix %s", cyan(m.prefix))
+	}
+	return len(actual), nil
+}
+
+func (m prefixMatcher) String() string {
+	return fmt.Sprintf("prefix %#v", string(m.prefix))
+}
+
+// MatchPrefix accepts any bytes that start with prefix.
+func MatchPrefix(prefix []byte) WriteMatcher {
+	return prefixMatcher{prefix: prefix}
+}
+
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+// Match implements WriteMatcher.
+func (m regexpMatcher) Match(actual []byte) (int, error) {
+	loc := m.re.FindIndex(actual)
+	if loc == nil {
+		return 0, nil
+	}
+	return loc[1], nil
+}
+
+func (m regexpMatcher) String() string {
+	return fmt.Sprintf("regexp %s", m.re.String())
+}
+
+// MatchRegexp accepts the bytes written so far once they contain a match
+// for re that ends at the last byte written; bytes written past the end
+// of the match are reported as a mismatch.
+func MatchRegexp(re *regexp.Regexp) WriteMatcher {
+	return regexpMatcher{re: re}
+}
+
+type jsonMatcher struct {
+	expected interface{}
+}
+
+// Match implements WriteMatcher.
+func (m jsonMatcher) Match(actual []byte) (int, error) {
+	if !json.Valid(actual) {
+		return 0, nil
+	}
+	var actualVal interface{}
+	if err := json.Unmarshal(actual, &actualVal); err != nil {
+		return 0, err
+	}
+	expectedBytes, err := json.Marshal(m.expected)
+	if err != nil {
+		return 0, err
+	}
+	var expectedVal interface{}
+	if err := json.Unmarshal(expectedBytes, &expectedVal); err != nil {
+		return 0, err
+	}
+	if !reflect.DeepEqual(actualVal, expectedVal) {
+		return 0, fmt.Errorf("JSON mismatch: expected=%s actual=%s", expectedBytes, actual)
+	}
+	return len(actual), nil
+}
+
+func (m jsonMatcher) String() string {
+	b, err := json.Marshal(m.expected)
+	if err != nil {
+		return "JSON <invalid expectation>"
+	}
+	return fmt.Sprintf("JSON %s", b)
+}
+
+// MatchJSON accepts bytes that, once parsed, are structurally equal to
+// expected: key order and whitespace are ignored.
+func MatchJSON(expected interface{}) WriteMatcher {
+	return jsonMatcher{expected: expected}
+}
+
+type httpRequestMatcher struct {
+	method  string
+	path    string
+	headers map[string]string
+}
+
+// Match implements WriteMatcher.
+func (m httpRequestMatcher) Match(actual []byte) (int, error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(actual)))
+	if err != nil {
+		// Most parse failures here just mean the request hasn't fully
+		// arrived yet; wait for more bytes rather than failing outright.
+		return 0, nil
+	}
+	if req.Method != m.method {
+		return 0, fmt.Errorf("expected method %s, got %s", m.method, req.Method)
+	}
+	if req.URL.Path != m.path {
+		return 0, fmt.Errorf("expected path %s, got %s", m.path, req.URL.Path)
+	}
+	for key, value := range m.headers {
+		if got := req.Header.Get(key); got != value {
+			return 0, fmt.Errorf("expected header %s=%q, got %q", key, value, got)
+		}
+	}
+	return len(actual), nil
+}
+
+func (m httpRequestMatcher) String() string {
+	return fmt.Sprintf("HTTP request %s %s", m.method, m.path)
+}
+
+// MatchHTTPRequest accepts bytes that parse as an HTTP request with the
+// given method and path, and that carry at least the given headers.
+func MatchHTTPRequest(method, path string, headers map[string]string) WriteMatcher {
+	return httpRequestMatcher{method: method, path: path, headers: headers}
+}
@@ -0,0 +1,80 @@
+package mockconn
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestWriteMatchAny(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		WriteMatch(MatchAny(5)),
+		Close(),
+	)
+	n, err := mock.Write([]byte("hello"))
+	if n != 5 {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	mock.Close()
+	errors := mock.Verify()
+	if len(errors) != 0 {
+		t.Errorf("mock shouldn't have any errors, but %d", len(errors))
+	}
+}
+
+func TestWriteMatchPrefix(t *testing.T) {
+	mock := New(nil)
+	mock.SetExpectedActions(
+		WriteMatch(MatchPrefix([]byte("GET "))),
+	)
+	_, err := mock.Write([]byte("POST /"))
+	if err == nil {
+		t.Error("err should not be nil")
+	}
+}
+
+func TestWriteMatchRegexp(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		WriteMatch(MatchRegexp(regexp.MustCompile(`^id-\d+$`))),
+	)
+	n, err := mock.Write([]byte("id-42"))
+	if n != len("id-42") {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+}
+
+func TestWriteMatchJSON(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		WriteMatch(MatchJSON(map[string]interface{}{"a": float64(1), "b": "two"})),
+	)
+	n, err := mock.Write([]byte(`{"b": "two", "a": 1}`))
+	if n == 0 {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+}
+
+func TestWriteMatchHTTPRequest(t *testing.T) {
+	mock := New(t)
+	mock.SetExpectedActions(
+		WriteMatch(MatchHTTPRequest("GET", "/hello", map[string]string{"X-Test": "1"})),
+	)
+	request := "GET /hello HTTP/1.1\r\nHost: example.com\r\nX-Test: 1\r\n\r\n"
+	n, err := mock.Write([]byte(request))
+	if n != len(request) {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+}
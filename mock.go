@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/fatih/color"
+	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -20,6 +22,14 @@ const (
 	WriteActionType
 	// CloseAction type
 	CloseActionType
+	// WriteFrameAction type
+	WriteFrameActionType
+	// WriteMatchAction type
+	WriteMatchActionType
+	// ReadFromAction type
+	ReadFromActionType
+	// WriteToAction type
+	WriteToActionType
 	nullActionType
 )
 
@@ -47,6 +57,10 @@ type Action interface {
 type readAction struct {
 	data     []byte
 	original []byte
+	// scripted marks actions created via Read(), as opposed to the ones a
+	// Pipe appends internally to deliver bytes written by its peer. Only
+	// scripted actions are asserted against in pushReadData.
+	scripted bool
 }
 
 // Read creates action to read.
@@ -62,10 +76,14 @@ type readAction struct {
 //   conn.Read(d) // 'mon' : ok
 //   conn.Read(d) // 'tus' : ok
 //   conn.Read(d) // ''    : ok
+//
+// On a Conn returned by Pipe, a Read action instead asserts that the data
+// its peer writes matches data.
 func Read(data []byte) Action {
 	return &readAction{
 		data:     data,
 		original: data,
+		scripted: true,
 	}
 }
 
@@ -119,18 +137,44 @@ func (n nullAction) Type() ActionType {
 	return nullActionType
 }
 
+// timeoutError is returned by Read/Write once a deadline has passed.
+// It satisfies net.Error so callers can detect it with a type assertion.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "mockconn: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errTimeout net.Error = &timeoutError{}
+
 // Conn is a mock object that has net.Conn interface.
+//
+// Conn is safe for concurrent use: mu guards scenario, current, closed
+// and the deadline state so Read/Write/Close/SetXDeadline may be called
+// from different goroutines, as real net.Conn implementations allow.
 type Conn struct {
 	t          *testing.T
+	mu         sync.Mutex
 	errors     []error
 	scenario   []Action
 	current    int
 	localAddr  net.Addr
 	remoteAddr net.Addr
 	closed     bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	writeTimer    *time.Timer
+	readTimeout   chan struct{}
+	writeTimeout  chan struct{}
+	changed       chan struct{}
+
+	pipePeer   *Conn
+	peerClosed bool
 }
 
-func (c Conn) getAction(i int) Action {
+func (c *Conn) getAction(i int) Action {
 	if i < len(c.scenario) {
 		return c.scenario[i]
 	}
@@ -143,9 +187,34 @@ func (c Conn) getAction(i int) Action {
 // show scenario summary when Verify() is called.
 func New(t *testing.T) *Conn {
 	return &Conn{
-		t:          t,
-		localAddr:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345},
-		remoteAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080},
+		t:            t,
+		localAddr:    &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345},
+		remoteAddr:   &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080},
+		readTimeout:  make(chan struct{}),
+		writeTimeout: make(chan struct{}),
+		changed:      make(chan struct{}),
+	}
+}
+
+// Pipe returns two *Conn instances connected to each other, like net.Pipe:
+// a Write on one becomes readable on the other. stop closes both ends.
+//
+// Both sides still accept SetExpectedActions, so scripted verification
+// can be layered on top of the live transport: a Read action asserts
+// what the peer wrote, while Write actions are checked against the
+// scripted data as usual and, on success, delivered to the peer.
+func Pipe() (c1, c2 *Conn, stop func()) {
+	c1 = New(nil)
+	c2 = New(nil)
+	c1.SetLocalAddr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10001})
+	c2.SetLocalAddr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10002})
+	c1.SetRemoteAddr(c2.localAddr)
+	c2.SetRemoteAddr(c1.localAddr)
+	c1.pipePeer = c2
+	c2.pipePeer = c1
+	return c1, c2, func() {
+		c1.Close()
+		c2.Close()
 	}
 }
 
@@ -161,18 +230,22 @@ func (c *Conn) SetRemoteAddr(addr net.Addr) {
 
 // SetExpectedActions sets expected behavior.
 func (c *Conn) SetExpectedActions(scenario ...Action) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.scenario = scenario
 }
 
 // Verify returns all errors
 func (c *Conn) Verify() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	errors := make([]error, len(c.errors))
 	copy(errors, c.errors)
 	current := c.getAction(c.current)
 	switch current.Type() {
 	case ReadActionType:
 		read := current.(*readAction)
-		if len(read.data) > 0 {
+		if len(read.data) > 0 && read.scripted {
 			c.addError(fmt.Errorf("%s: mock socket scenario %d - there is remained data to read: %s", errorLabel, c.current+1, yellow(read.data)))
 		}
 		c.current++
@@ -180,6 +253,14 @@ func (c *Conn) Verify() []error {
 		write := current.(*writeAction)
 		c.addError(fmt.Errorf("%s: mock socket scenario %d - there is remained data to write: %s", errorLabel, c.current+1, yellow(write.data)))
 		c.current++
+	case WriteFrameActionType:
+		frame := current.(*frameWriteAction)
+		c.addError(fmt.Errorf("%s: mock socket scenario %d - there is remained frame to write: %s", errorLabel, c.current+1, yellow(frame.payload)))
+		c.current++
+	case WriteMatchActionType:
+		match := current.(*matchWriteAction)
+		c.addError(fmt.Errorf("%s: mock socket scenario %d - there is remained match to write: %s", errorLabel, c.current+1, match.matcher))
+		c.current++
 	}
 	if c.current < len(c.scenario) {
 		c.addError(fmt.Errorf("%s: Unconsumed senario exists - %d/%d", errorLabel, len(c.scenario)-c.current, len(c.scenario)))
@@ -208,7 +289,13 @@ func (c *Conn) Verify() []error {
 				write := current.(*writeAction)
 				fmt.Fprintf(&buffer, "%s (%d) Write(): %s\n", result, c.current+1, logText(ok, write.original, write.data))
 			case CloseActionType:
-				fmt.Fprintf(&buffer, "%s (%d) Close(): %s\n", result, c.current+1)
+				fmt.Fprintf(&buffer, "%s (%d) Close()\n", result, c.current+1)
+			case WriteFrameActionType:
+				frame := current.(*frameWriteAction)
+				fmt.Fprintf(&buffer, "%s (%d) WriteFrame(): %s\n", result, c.current+1, cyan(frame.payload))
+			case WriteMatchActionType:
+				match := current.(*matchWriteAction)
+				fmt.Fprintf(&buffer, "%s (%d) WriteMatch(): %s\n", result, c.current+1, cyanColor(match.matcher.String()))
 			}
 		}
 		c.t.Log(buffer.String())
@@ -226,6 +313,8 @@ func logText(ok bool, original, actual []byte) string {
 	return yellow(original)
 }
 
+// addError records err and, when t is set, reports it immediately.
+// Callers must hold c.mu.
 func (c *Conn) addError(err error) error {
 	c.errors = append(c.errors, err)
 	if c.t != nil {
@@ -234,109 +323,296 @@ func (c *Conn) addError(err error) error {
 	return err
 }
 
+// shouldBlockOnRead reports whether an exhausted read action should block
+// waiting for more data instead of returning (0, nil) right away. Plain
+// scripted conns keep the original, non-blocking behavior; conns that are
+// wired to a peer (see Pipe) or that have an active read deadline block so
+// that the deadline machinery below has something to unblock.
+func (c *Conn) shouldBlockOnRead() bool {
+	return c.pipePeer != nil || !c.readDeadline.IsZero()
+}
+
 // Read reads data from the connection.
-// Read can be made to time out and return a Error with Timeout() == true
-// after a fixed time limit; see SetDeadline and SetReadDeadline.
+// Read can be made to time out and return an error with Timeout() == true
+// after a fixed time limit; see SetDeadline and SetReadDeadline. A blocked
+// Read is also unblocked by Close or by resetting the read deadline from
+// another goroutine.
 func (c *Conn) Read(b []byte) (n int, err error) {
-	if c.closed {
-		return 0, errors.New("already closed")
-	}
-	current := c.getAction(c.current)
-	switch current.Type() {
-	case ReadActionType:
-		read := current.(*readAction)
-		if len(read.data) > 0 {
-			n := copy(b, read.data)
-			read.data = read.data[n:]
-			return n, nil
+	c.mu.Lock()
+	for {
+		if c.closed {
+			c.mu.Unlock()
+			return 0, errors.New("already closed")
 		}
-		next := c.getAction(c.current + 1)
-		if next.Type() == ReadActionType {
-			c.current++
-			return c.Read(b)
+		select {
+		case <-c.readTimeout:
+			c.mu.Unlock()
+			return 0, errTimeout
+		default:
 		}
-		return 0, nil
-	case WriteActionType:
-		write := current.(*writeAction)
-		if len(write.data) == 0 {
-			c.current++
-			current = c.scenario[c.current]
-		} else {
-			return 0, c.addError(fmt.Errorf("%s: socket scenario %d - should close, but Read() is called", errorLabel, c.current+1))
+		current := c.getAction(c.current)
+		switch current.Type() {
+		case ReadActionType:
+			read := current.(*readAction)
+			if len(read.data) > 0 {
+				n := copy(b, read.data)
+				read.data = read.data[n:]
+				c.mu.Unlock()
+				return n, nil
+			}
+			next := c.getAction(c.current + 1)
+			if next.Type() == ReadActionType {
+				c.current++
+				continue
+			}
+		case WriteActionType:
+			write := current.(*writeAction)
+			if len(write.data) == 0 {
+				c.current++
+				continue
+			}
+			err := c.addError(fmt.Errorf("%s: socket scenario %d - should close, but Read() is called", errorLabel, c.current+1))
+			c.mu.Unlock()
+			return 0, err
+		case CloseActionType:
+			err := c.addError(fmt.Errorf("%s: socket scenario %d - should close, but Read() is called", errorLabel, c.current+1))
+			c.mu.Unlock()
+			return 0, err
+		}
+		if c.peerClosed {
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+		if !c.shouldBlockOnRead() {
+			c.mu.Unlock()
+			return 0, nil
+		}
+		changed := c.changed
+		readTimeout := c.readTimeout
+		c.mu.Unlock()
+		select {
+		case <-changed:
+			c.mu.Lock()
+		case <-readTimeout:
+			return 0, errTimeout
 		}
-	case CloseActionType:
-		return 0, c.addError(fmt.Errorf("%s: socket scenario %d - should close, but Read() is called", errorLabel, c.current+1))
 	}
-	return 0, nil
 }
 
 // Write writes data to the connection.
-// Write can be made to time out and return a Error with Timeout() == true
+// Write can be made to time out and return an error with Timeout() == true
 // after a fixed time limit; see SetDeadline and SetWriteDeadline.
+// Even if write times out, it may return n > 0, indicating that
+// some of the data was successfully written.
 func (c *Conn) Write(b []byte) (n int, err error) {
-	if c.closed {
-		return 0, errors.New("already closed")
-	}
-	current := c.getAction(c.current)
-	switch current.Type() {
-	case ReadActionType:
-		read := current.(*readAction)
-		if len(read.data) > 0 {
-			return 0, c.addError(fmt.Errorf("%s: socket scenario %d - should read data, but Write() is called", errorLabel, c.current+1))
+	c.mu.Lock()
+	for {
+		if c.closed {
+			c.mu.Unlock()
+			return 0, errors.New("already closed")
 		}
-		c.current++
-		return c.Write(b)
-	case WriteActionType:
-		write := current.(*writeAction)
-		if len(b) <= len(write.data) {
-			same := true
-			for i, ch := range b {
-				if ch != write.data[i] {
-					same = false
+		select {
+		case <-c.writeTimeout:
+			c.mu.Unlock()
+			return 0, errTimeout
+		default:
+		}
+		current := c.getAction(c.current)
+		switch current.Type() {
+		case ReadActionType:
+			read := current.(*readAction)
+			if len(read.data) > 0 {
+				if !read.scripted {
+					// unconsumed data a Pipe peer delivered concurrently;
+					// it doesn't block this Write, it's just still waiting
+					// to be Read.
 					break
 				}
+				err := c.addError(fmt.Errorf("%s: socket scenario %d - should read data, but Write() is called", errorLabel, c.current+1))
+				c.mu.Unlock()
+				return 0, err
+			}
+			c.current++
+			continue
+		case WriteActionType:
+			write := current.(*writeAction)
+			if len(b) <= len(write.data) {
+				same := true
+				for i, ch := range b {
+					if ch != write.data[i] {
+						same = false
+						break
+					}
+				}
+				if !same {
+					err := c.addError(fmt.Errorf("%s: socket scenario %d - Write() expected=%s actual=%s", errorLabel, c.current+1, cyan(write.data), yellow(b)))
+					c.mu.Unlock()
+					return 0, err
+				}
+				if len(b) == len(write.data) {
+					c.current++
+				} else {
+					write.data = write.data[len(b):]
+				}
+				peer := c.pipePeer
+				c.mu.Unlock()
+				if peer != nil {
+					peer.pushReadData(b)
+				}
+				return len(b), nil
 			}
-			if !same {
-				return 0, c.addError(fmt.Errorf("%s: socket scenario %d - Write() expected=%s actual=%s", errorLabel, c.current+1, cyan(write.data), yellow(b)))
+			err := c.addError(fmt.Errorf("%s: socket scenario %d - Write() expected=%s actual=%s", errorLabel, c.current+1, cyan(write.data), yellow(b)))
+			c.mu.Unlock()
+			return 0, err
+		case CloseActionType:
+			err := c.addError(fmt.Errorf("%s: socket scenario %d - should close, but Write() is called", errorLabel, c.current+1))
+			c.mu.Unlock()
+			return 0, err
+		case WriteFrameActionType:
+			frame := current.(*frameWriteAction)
+			frame.buffer = append(frame.buffer, b...)
+			payload, decodeErr := frame.codec.Decode(bytes.NewReader(frame.buffer))
+			if decodeErr != nil {
+				if errors.Is(decodeErr, io.EOF) || errors.Is(decodeErr, io.ErrUnexpectedEOF) {
+					// frame isn't complete yet, wait for the rest of it
+					c.mu.Unlock()
+					return len(b), nil
+				}
+				err := c.addError(fmt.Errorf("%s: socket scenario %d - WriteFrame() framing error: %v, raw=%s", errorLabel, c.current+1, decodeErr, yellow(frame.buffer)))
+				c.mu.Unlock()
+				return 0, err
 			}
-			if len(b) == len(write.data) {
-				c.current++
-			} else {
-				write.data = write.data[len(b):]
+			if !bytes.Equal(payload, frame.payload) {
+				err := c.addError(fmt.Errorf("%s: socket scenario %d - WriteFrame() payload expected=%s actual=%s, raw=%s", errorLabel, c.current+1, cyan(frame.payload), yellow(payload), yellow(frame.buffer)))
+				c.mu.Unlock()
+				return 0, err
+			}
+			c.current++
+			c.mu.Unlock()
+			return len(b), nil
+		case WriteMatchActionType:
+			match := current.(*matchWriteAction)
+			match.buffer = append(match.buffer, b...)
+			consumed, matchErr := match.matcher.Match(match.buffer)
+			if matchErr != nil {
+				err := c.addError(fmt.Errorf("%s: socket scenario %d - WriteMatch(%s) failed: %v, raw=%s", errorLabel, c.current+1, match.matcher, matchErr, yellow(match.buffer)))
+				c.mu.Unlock()
+				return 0, err
+			}
+			if consumed == 0 {
+				// matcher needs more bytes before it can decide
+				c.mu.Unlock()
+				return len(b), nil
+			}
+			if consumed != len(match.buffer) {
+				err := c.addError(fmt.Errorf("%s: socket scenario %d - WriteMatch(%s) left %d trailing byte(s) unmatched, raw=%s", errorLabel, c.current+1, match.matcher, len(match.buffer)-consumed, yellow(match.buffer)))
+				c.mu.Unlock()
+				return 0, err
 			}
+			c.current++
+			c.mu.Unlock()
+			return len(b), nil
+		}
+		if c.pipePeer != nil {
+			peer := c.pipePeer
+			c.mu.Unlock()
+			peer.pushReadData(b)
 			return len(b), nil
 		}
-		return 0, c.addError(fmt.Errorf("%s: socket scenario %d - Write() expected=%s actual=%s", errorLabel, c.current+1, cyan(write.data), yellow(b)))
-	case CloseActionType:
-		return 0, c.addError(fmt.Errorf("%s: socket scenario %d - should close, but Write() is called", errorLabel, c.current+1))
+		c.mu.Unlock()
+		return 0, nil
+	}
+}
+
+// pushReadData delivers data written by a Pipe peer. If the next pending
+// action is a scripted Read, the data is asserted against it; the bytes
+// are then appended as a new (unscripted) Read action so Read() always
+// returns what was actually written, and any Read blocked waiting for
+// more data is woken up.
+func (c *Conn) pushReadData(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	if ra, ok := c.getAction(c.current).(*readAction); ok && ra.scripted {
+		expected := ra.original
+		if len(cp) > len(expected) || !bytes.Equal(cp, expected[:len(cp)]) {
+			c.addError(fmt.Errorf("%s: socket scenario %d - Read() expected=%s actual=%s", errorLabel, c.current+1, cyan(expected), yellow(cp)))
+		}
+		c.current++
 	}
-	return 0, nil
+	c.scenario = append(c.scenario, &readAction{data: cp, original: cp})
+	c.broadcastLocked()
+}
+
+// broadcastLocked wakes every goroutine blocked in Read or Write waiting
+// on c.changed. Callers must hold c.mu.
+func (c *Conn) broadcastLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
 }
 
 // Close closes the connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
 func (c *Conn) Close() error {
-	if c.closed {
-		return errors.New("already closed")
-	}
-	current := c.getAction(c.current)
-	switch current.Type() {
-	case ReadActionType:
-		read := current.(*readAction)
-		if len(read.data) > 0 {
-			return c.addError(fmt.Errorf("%s: socket scenario %d - should read data, but Close() is called", errorLabel, c.current+1))
+	c.mu.Lock()
+	for {
+		if c.closed {
+			c.mu.Unlock()
+			return errors.New("already closed")
 		}
-		c.current++
-		return c.Close()
-	case WriteActionType:
-		return c.addError(fmt.Errorf("%s: socket scenario %d - should write data, but Close() is called", errorLabel, c.current+1))
-	case CloseActionType:
-		c.current++
+		current := c.getAction(c.current)
+		switch current.Type() {
+		case ReadActionType:
+			read := current.(*readAction)
+			if len(read.data) > 0 {
+				if !read.scripted {
+					// unconsumed data a Pipe peer delivered
+					// concurrently; Close discards it like a real
+					// net.Conn would.
+					break
+				}
+				err := c.addError(fmt.Errorf("%s: socket scenario %d - should read data, but Close() is called", errorLabel, c.current+1))
+				c.mu.Unlock()
+				return err
+			}
+			c.current++
+			continue
+		case WriteActionType:
+			err := c.addError(fmt.Errorf("%s: socket scenario %d - should write data, but Close() is called", errorLabel, c.current+1))
+			c.mu.Unlock()
+			return err
+		case CloseActionType:
+			c.current++
+		}
+		break
 	}
 	c.closed = true
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+	}
+	if c.writeTimer != nil {
+		c.writeTimer.Stop()
+	}
+	c.broadcastLocked()
+	peer := c.pipePeer
+	c.mu.Unlock()
+	if peer != nil {
+		peer.notifyPeerClosed()
+	}
 	return nil
 }
 
+// notifyPeerClosed marks that this Conn's Pipe peer has closed, so a Read
+// blocked waiting for more data returns io.EOF instead of waiting forever,
+// and wakes any Read currently blocked.
+func (c *Conn) notifyPeerClosed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peerClosed = true
+	c.broadcastLocked()
+}
+
 // LocalAddr returns the local network address.
 func (c *Conn) LocalAddr() net.Addr {
 	return c.localAddr
@@ -347,6 +623,27 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.remoteAddr
 }
 
+// resetTimeoutLocked stops the previous timer for a deadline, installs a
+// fresh timeout channel, and - if the deadline is non-zero - arranges for
+// that channel to be closed when the deadline fires (or immediately, if
+// the deadline has already passed). Callers must hold c.mu.
+func resetTimeoutLocked(deadline time.Time, timer **time.Timer) chan struct{} {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	ch := make(chan struct{})
+	if deadline.IsZero() {
+		return ch
+	}
+	if d := time.Until(deadline); d > 0 {
+		*timer = time.AfterFunc(d, func() { close(ch) })
+	} else {
+		close(ch)
+	}
+	return ch
+}
+
 // SetDeadline sets the read and write deadlines associated
 // with the connection. It is equivalent to calling both
 // SetReadDeadline and SetWriteDeadline.
@@ -361,18 +658,30 @@ func (c *Conn) RemoteAddr() net.Addr {
 //
 // A zero value for t means I/O operations will not time out.
 func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.closed {
 		return errors.New("closed")
 	}
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.readTimeout = resetTimeoutLocked(t, &c.readTimer)
+	c.writeTimeout = resetTimeoutLocked(t, &c.writeTimer)
+	c.broadcastLocked()
 	return nil
 }
 
 // SetReadDeadline sets the deadline for future Read calls.
 // A zero value for t means Read will not time out.
 func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.closed {
 		return errors.New("closed")
 	}
+	c.readDeadline = t
+	c.readTimeout = resetTimeoutLocked(t, &c.readTimer)
+	c.broadcastLocked()
 	return nil
 }
 
@@ -381,8 +690,13 @@ func (c *Conn) SetReadDeadline(t time.Time) error {
 // some of the data was successfully written.
 // A zero value for t means Write will not time out.
 func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.closed {
 		return errors.New("closed")
 	}
+	c.writeDeadline = t
+	c.writeTimeout = resetTimeoutLocked(t, &c.writeTimer)
+	c.broadcastLocked()
 	return nil
 }
@@ -125,3 +125,64 @@ func TestWriteError(t *testing.T) {
 		}
 	}
 }
+
+func TestPipe(t *testing.T) {
+	c1, c2, stop := Pipe()
+	defer stop()
+
+	n, err := c1.Write([]byte("hello"))
+	if n != len("hello") {
+		t.Errorf("Write result: %d", n)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+
+	buffer := make([]byte, 100)
+	n, err = c2.Read(buffer)
+	if string(buffer[:n]) != "hello" {
+		t.Errorf("Read result: %q", buffer[:n])
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+}
+
+func TestPipeScriptedReadAssertsPeerWrite(t *testing.T) {
+	c1, c2, stop := Pipe()
+	defer stop()
+
+	c2.SetExpectedActions(
+		Read([]byte("hello")),
+	)
+	c1.Write([]byte("hello"))
+
+	buffer := make([]byte, 100)
+	c2.Read(buffer)
+
+	errors := c2.Verify()
+	if len(errors) != 0 {
+		t.Errorf("mock shouldn't have any errors, but %d", len(errors))
+		for i, err := range errors {
+			t.Log(i+1, err.Error())
+		}
+	}
+}
+
+func TestPipeScriptedReadMismatch(t *testing.T) {
+	c1, c2, stop := Pipe()
+	defer stop()
+
+	c2.SetExpectedActions(
+		Read([]byte("hello")),
+	)
+	c1.Write([]byte("world"))
+
+	buffer := make([]byte, 100)
+	c2.Read(buffer)
+
+	errors := c2.Verify()
+	if len(errors) == 0 {
+		t.Error("mock should have errors")
+	}
+}
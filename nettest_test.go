@@ -0,0 +1,23 @@
+package mockconn
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/nettest"
+)
+
+func makePipe() (net.Conn, net.Conn, func(), error) {
+	c1, c2, stop := Pipe()
+	return c1, c2, stop, nil
+}
+
+// TestConnConformance runs the full golang.org/x/net/nettest.TestConn
+// suite (BasicIO, PingPong, RacyRead/RacyWrite, every deadline case,
+// CloseTimeout, ConcurrentMethods) against a Pipe()-connected pair. This
+// is the actual compliance bar for Pipe(): it must run to completion
+// rather than hang, since several of its subtests rely on one side's
+// Close unblocking a concurrent Read on the other side.
+func TestConnConformance(t *testing.T) {
+	nettest.TestConn(t, makePipe)
+}
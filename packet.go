@@ -0,0 +1,338 @@
+package mockconn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type readFromAction struct {
+	data []byte
+	addr net.Addr
+}
+
+func (r readFromAction) Type() ActionType {
+	return ReadFromActionType
+}
+
+// ReadFrom creates an action to read a single datagram of data, as if it
+// had arrived from addr.
+func ReadFrom(data []byte, addr net.Addr) Action {
+	return &readFromAction{data: data, addr: addr}
+}
+
+type writeToAction struct {
+	data []byte
+	addr net.Addr
+}
+
+func (w writeToAction) Type() ActionType {
+	return WriteToActionType
+}
+
+// WriteTo creates an action expecting a single datagram of data sent to
+// addr.
+func WriteTo(data []byte, addr net.Addr) Action {
+	return &writeToAction{data: data, addr: addr}
+}
+
+// PacketConn is a mock object that has the net.PacketConn interface (and,
+// via Read/Write/RemoteAddr, net.Conn as well). Unlike Conn, it is
+// datagram-oriented: each scripted ReadFrom/WriteTo action corresponds to
+// exactly one packet, a short read buffer truncates the rest of the
+// datagram instead of leaving it for the next call, and a WriteTo must
+// match the scripted payload and destination exactly.
+type PacketConn struct {
+	t          *testing.T
+	mu         sync.Mutex
+	errors     []error
+	scenario   []Action
+	current    int
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	closed     bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readTimer     *time.Timer
+	writeTimer    *time.Timer
+	readTimeout   chan struct{}
+	writeTimeout  chan struct{}
+	changed       chan struct{}
+}
+
+// NewPacket creates a mock packet connection instance.
+//
+// If t is passed, it calls t.Error in unit tests as each error occurs.
+// Unlike Conn.Verify, PacketConn.Verify does not log a scenario summary.
+func NewPacket(t *testing.T) *PacketConn {
+	return &PacketConn{
+		t:            t,
+		localAddr:    &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345},
+		remoteAddr:   &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080},
+		readTimeout:  make(chan struct{}),
+		writeTimeout: make(chan struct{}),
+		changed:      make(chan struct{}),
+	}
+}
+
+func (p *PacketConn) getAction(i int) Action {
+	if i < len(p.scenario) {
+		return p.scenario[i]
+	}
+	return &nullAction{}
+}
+
+// SetLocalAddr sets local address to return.
+func (p *PacketConn) SetLocalAddr(addr net.Addr) {
+	p.localAddr = addr
+}
+
+// SetRemoteAddr sets the address Write() sends to when used as a net.Conn.
+func (p *PacketConn) SetRemoteAddr(addr net.Addr) {
+	p.remoteAddr = addr
+}
+
+// SetExpectedActions sets expected behavior.
+func (p *PacketConn) SetExpectedActions(scenario ...Action) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scenario = scenario
+}
+
+// addError records err and, when t is set, reports it immediately.
+// Callers must hold p.mu.
+func (p *PacketConn) addError(err error) error {
+	p.errors = append(p.errors, err)
+	if p.t != nil {
+		p.t.Error(err.Error())
+	}
+	return err
+}
+
+// Verify returns all errors.
+func (p *PacketConn) Verify() []error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := make([]error, len(p.errors))
+	copy(errs, p.errors)
+	switch p.getAction(p.current).Type() {
+	case ReadFromActionType:
+		p.addError(fmt.Errorf("%s: mock packet scenario %d - there is a remained datagram to read", errorLabel, p.current+1))
+		p.current++
+	case WriteToActionType:
+		p.addError(fmt.Errorf("%s: mock packet scenario %d - there is a remained datagram to write", errorLabel, p.current+1))
+		p.current++
+	}
+	if p.current < len(p.scenario) {
+		p.addError(fmt.Errorf("%s: Unconsumed senario exists - %d/%d", errorLabel, len(p.scenario)-p.current, len(p.scenario)))
+	}
+	result := p.errors
+	p.errors = errs
+	return result
+}
+
+// ReadFrom reads a single datagram. If b is shorter than the scripted
+// datagram, the rest of that datagram is discarded, mirroring real UDP
+// semantics.
+func (p *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return 0, nil, errors.New("already closed")
+		}
+		select {
+		case <-p.readTimeout:
+			p.mu.Unlock()
+			return 0, nil, errTimeout
+		default:
+		}
+		current := p.getAction(p.current)
+		switch current.Type() {
+		case ReadFromActionType:
+			read := current.(*readFromAction)
+			n := copy(b, read.data)
+			p.current++
+			p.mu.Unlock()
+			return n, read.addr, nil
+		case WriteToActionType:
+			err := p.addError(fmt.Errorf("%s: packet scenario %d - should write, but ReadFrom() is called", errorLabel, p.current+1))
+			p.mu.Unlock()
+			return 0, nil, err
+		case CloseActionType:
+			err := p.addError(fmt.Errorf("%s: packet scenario %d - should close, but ReadFrom() is called", errorLabel, p.current+1))
+			p.mu.Unlock()
+			return 0, nil, err
+		}
+		if p.readDeadline.IsZero() {
+			p.mu.Unlock()
+			return 0, nil, nil
+		}
+		changed := p.changed
+		readTimeout := p.readTimeout
+		p.mu.Unlock()
+		select {
+		case <-changed:
+			p.mu.Lock()
+		case <-readTimeout:
+			return 0, nil, errTimeout
+		}
+	}
+}
+
+// WriteTo writes a single datagram, which must match the scripted
+// payload and destination exactly.
+func (p *PacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return 0, errors.New("already closed")
+		}
+		select {
+		case <-p.writeTimeout:
+			p.mu.Unlock()
+			return 0, errTimeout
+		default:
+		}
+		current := p.getAction(p.current)
+		switch current.Type() {
+		case ReadFromActionType:
+			err := p.addError(fmt.Errorf("%s: packet scenario %d - should read, but WriteTo() is called", errorLabel, p.current+1))
+			p.mu.Unlock()
+			return 0, err
+		case WriteToActionType:
+			write := current.(*writeToAction)
+			if !bytes.Equal(b, write.data) {
+				err := p.addError(fmt.Errorf("%s: packet scenario %d - WriteTo() expected=%s actual=%s", errorLabel, p.current+1, cyan(write.data), yellow(b)))
+				p.mu.Unlock()
+				return 0, err
+			}
+			if addr.String() != write.addr.String() {
+				err := p.addError(fmt.Errorf("%s: packet scenario %d - WriteTo() expected addr=%s actual addr=%s", errorLabel, p.current+1, write.addr, addr))
+				p.mu.Unlock()
+				return 0, err
+			}
+			p.current++
+			p.mu.Unlock()
+			return len(b), nil
+		case CloseActionType:
+			err := p.addError(fmt.Errorf("%s: packet scenario %d - should close, but WriteTo() is called", errorLabel, p.current+1))
+			p.mu.Unlock()
+			return 0, err
+		}
+		p.mu.Unlock()
+		return 0, nil
+	}
+}
+
+// Read implements net.Conn by discarding the sender address from ReadFrom.
+func (p *PacketConn) Read(b []byte) (n int, err error) {
+	n, _, err = p.ReadFrom(b)
+	return n, err
+}
+
+// Write implements net.Conn by sending to RemoteAddr().
+func (p *PacketConn) Write(b []byte) (n int, err error) {
+	return p.WriteTo(b, p.remoteAddr)
+}
+
+// Close closes the connection.
+func (p *PacketConn) Close() error {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return errors.New("already closed")
+		}
+		current := p.getAction(p.current)
+		switch current.Type() {
+		case ReadFromActionType:
+			err := p.addError(fmt.Errorf("%s: packet scenario %d - should read, but Close() is called", errorLabel, p.current+1))
+			p.mu.Unlock()
+			return err
+		case WriteToActionType:
+			err := p.addError(fmt.Errorf("%s: packet scenario %d - should write, but Close() is called", errorLabel, p.current+1))
+			p.mu.Unlock()
+			return err
+		case CloseActionType:
+			p.current++
+		}
+		break
+	}
+	p.closed = true
+	if p.readTimer != nil {
+		p.readTimer.Stop()
+	}
+	if p.writeTimer != nil {
+		p.writeTimer.Stop()
+	}
+	p.broadcastLocked()
+	p.mu.Unlock()
+	return nil
+}
+
+// broadcastLocked wakes every goroutine blocked in ReadFrom or WriteTo
+// waiting on p.changed. Callers must hold p.mu.
+func (p *PacketConn) broadcastLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// LocalAddr returns the local network address.
+func (p *PacketConn) LocalAddr() net.Addr {
+	return p.localAddr
+}
+
+// RemoteAddr returns the remote network address used by Write().
+func (p *PacketConn) RemoteAddr() net.Addr {
+	return p.remoteAddr
+}
+
+// SetDeadline sets the read and write deadlines. See Conn.SetDeadline.
+func (p *PacketConn) SetDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errors.New("closed")
+	}
+	p.readDeadline = t
+	p.writeDeadline = t
+	p.readTimeout = resetTimeoutLocked(t, &p.readTimer)
+	p.writeTimeout = resetTimeoutLocked(t, &p.writeTimer)
+	p.broadcastLocked()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future ReadFrom calls. See
+// Conn.SetReadDeadline.
+func (p *PacketConn) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errors.New("closed")
+	}
+	p.readDeadline = t
+	p.readTimeout = resetTimeoutLocked(t, &p.readTimer)
+	p.broadcastLocked()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future WriteTo calls. See
+// Conn.SetWriteDeadline.
+func (p *PacketConn) SetWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errors.New("closed")
+	}
+	p.writeDeadline = t
+	p.writeTimeout = resetTimeoutLocked(t, &p.writeTimer)
+	p.broadcastLocked()
+	return nil
+}
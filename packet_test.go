@@ -0,0 +1,97 @@
+package mockconn
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacketConnReadFromTruncates(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242}
+	mock := NewPacket(t)
+	mock.SetExpectedActions(
+		ReadFrom([]byte("hello world"), peer),
+		Close(),
+	)
+	buffer := make([]byte, 5)
+	n, addr, err := mock.ReadFrom(buffer)
+	if n != 5 {
+		t.Errorf("ReadFrom result: %d", n)
+	}
+	if string(buffer[:n]) != "hello" {
+		t.Errorf("ReadFrom data: %q", buffer[:n])
+	}
+	if addr.String() != peer.String() {
+		t.Errorf("ReadFrom addr: %v", addr)
+	}
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	mock.Close()
+	errors := mock.Verify()
+	if len(errors) != 0 {
+		t.Errorf("mock shouldn't have any errors, but %d", len(errors))
+	}
+}
+
+func TestPacketConnWriteToMismatch(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242}
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9999}
+	mock := NewPacket(nil)
+	mock.SetExpectedActions(
+		WriteTo([]byte("ping"), peer),
+	)
+	_, err := mock.WriteTo([]byte("ping"), other)
+	if err == nil {
+		t.Error("err should not be nil")
+	}
+}
+
+func TestPacketConnAsNetConn(t *testing.T) {
+	var conn net.Conn = NewPacket(t)
+	conn.Close()
+}
+
+func TestPacketConnCloseUnblocksReadFrom(t *testing.T) {
+	mock := NewPacket(nil)
+	mock.SetReadDeadline(time.Now().Add(time.Hour))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := mock.ReadFrom(make([]byte, 1024))
+		done <- err
+	}()
+
+	mock.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("err should not be nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ReadFrom did not unblock after Close")
+	}
+}
+
+func TestPacketConnSetReadDeadlineUnblocksReadFrom(t *testing.T) {
+	mock := NewPacket(nil)
+	mock.SetReadDeadline(time.Now().Add(time.Hour))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := mock.ReadFrom(make([]byte, 1024))
+		done <- err
+	}()
+
+	mock.SetReadDeadline(time.Now().Add(-time.Second))
+
+	select {
+	case err := <-done:
+		if err != errTimeout {
+			t.Errorf("err should be errTimeout, but %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ReadFrom did not unblock after SetReadDeadline")
+	}
+}
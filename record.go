@@ -0,0 +1,177 @@
+package mockconn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// RecordOptions lets a RecordingConn normalize data before it is
+// journaled, so recordings stay deterministic across runs even when the
+// wire data itself isn't (TLS randomness, timestamps, request IDs, ...).
+type RecordOptions struct {
+	// RedactRead, if set, rewrites bytes read from the wrapped
+	// connection before they are recorded.
+	RedactRead func(data []byte) []byte
+	// RedactWrite, if set, rewrites bytes written to the wrapped
+	// connection before they are recorded.
+	RedactWrite func(data []byte) []byte
+}
+
+// RecordingConn wraps a live net.Conn, forwarding every call to it while
+// journaling Read/Write/Close as a scenario of Actions that can later be
+// replayed against Conn.SetExpectedActions for hermetic tests.
+type RecordingConn struct {
+	inner   net.Conn
+	mu      sync.Mutex
+	opts    RecordOptions
+	actions []Action
+}
+
+// Record wraps inner, recording every Close call and every Read/Write call
+// that moves at least one byte through the returned *RecordingConn; a
+// Read/Write that returns n == 0 is not recorded. Use SetOptions to
+// redact nondeterministic data before it's recorded.
+func Record(inner net.Conn) *RecordingConn {
+	return &RecordingConn{inner: inner}
+}
+
+// SetOptions sets the redaction hooks used while recording.
+func (r *RecordingConn) SetOptions(opts RecordOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.opts = opts
+}
+
+// Recorded returns the actions journaled so far.
+func (r *RecordingConn) Recorded() []Action {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	actions := make([]Action, len(r.actions))
+	copy(actions, r.actions)
+	return actions
+}
+
+// Read reads from the wrapped connection and, if any bytes were read,
+// journals them as a Read action.
+func (r *RecordingConn) Read(b []byte) (n int, err error) {
+	n, err = r.inner.Read(b)
+	if n > 0 {
+		data := redact(r.opts.RedactRead, b[:n])
+		r.mu.Lock()
+		r.actions = append(r.actions, &readAction{data: data, original: data, scripted: true})
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// Write writes to the wrapped connection and, if any bytes were written,
+// journals them as a Write action.
+func (r *RecordingConn) Write(b []byte) (n int, err error) {
+	n, err = r.inner.Write(b)
+	if n > 0 {
+		data := redact(r.opts.RedactWrite, b[:n])
+		r.mu.Lock()
+		r.actions = append(r.actions, &writeAction{data: data, original: data})
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// Close closes the wrapped connection and journals a Close action.
+func (r *RecordingConn) Close() error {
+	err := r.inner.Close()
+	r.mu.Lock()
+	r.actions = append(r.actions, &closeAction{})
+	r.mu.Unlock()
+	return err
+}
+
+func redact(fn func([]byte) []byte, data []byte) []byte {
+	cp := make([]byte, len(data))
+	copy(cp, data)
+	if fn != nil {
+		return fn(cp)
+	}
+	return cp
+}
+
+// LocalAddr returns the wrapped connection's local address.
+func (r *RecordingConn) LocalAddr() net.Addr {
+	return r.inner.LocalAddr()
+}
+
+// RemoteAddr returns the wrapped connection's remote address.
+func (r *RecordingConn) RemoteAddr() net.Addr {
+	return r.inner.RemoteAddr()
+}
+
+// SetDeadline forwards to the wrapped connection.
+func (r *RecordingConn) SetDeadline(t time.Time) error {
+	return r.inner.SetDeadline(t)
+}
+
+// SetReadDeadline forwards to the wrapped connection.
+func (r *RecordingConn) SetReadDeadline(t time.Time) error {
+	return r.inner.SetReadDeadline(t)
+}
+
+// SetWriteDeadline forwards to the wrapped connection.
+func (r *RecordingConn) SetWriteDeadline(t time.Time) error {
+	return r.inner.SetWriteDeadline(t)
+}
+
+// recordedAction is the stable on-disk representation of a journaled
+// Action; only the Read/Write/Close actions a RecordingConn can produce
+// are supported.
+type recordedAction struct {
+	Type ActionType `json:"type"`
+	Data []byte     `json:"data,omitempty"`
+}
+
+// Save writes the actions recorded so far to w as JSON, for later
+// replay via Load.
+func (r *RecordingConn) Save(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]recordedAction, 0, len(r.actions))
+	for _, a := range r.actions {
+		switch v := a.(type) {
+		case *readAction:
+			records = append(records, recordedAction{Type: ReadActionType, Data: v.original})
+		case *writeAction:
+			records = append(records, recordedAction{Type: WriteActionType, Data: v.original})
+		case *closeAction:
+			records = append(records, recordedAction{Type: CloseActionType})
+		default:
+			return fmt.Errorf("mockconn: cannot save action of type %T", a)
+		}
+	}
+	return json.NewEncoder(w).Encode(records)
+}
+
+// Load reads a recording saved by RecordingConn.Save and returns it as
+// Actions ready to pass to Conn.SetExpectedActions.
+func Load(r io.Reader) ([]Action, error) {
+	var records []recordedAction
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+	actions := make([]Action, 0, len(records))
+	for _, rec := range records {
+		switch rec.Type {
+		case ReadActionType:
+			actions = append(actions, Read(rec.Data))
+		case WriteActionType:
+			actions = append(actions, Write(rec.Data))
+		case CloseActionType:
+			actions = append(actions, Close())
+		default:
+			return nil, fmt.Errorf("mockconn: unsupported action type %d in recording", rec.Type)
+		}
+	}
+	return actions, nil
+}
@@ -0,0 +1,82 @@
+package mockconn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server, client, stop := Pipe()
+	defer stop()
+
+	recorded := Record(client)
+
+	go func() {
+		server.Write([]byte("hello"))
+		server.Close()
+	}()
+
+	buffer := make([]byte, 100)
+	n, err := recorded.Read(buffer)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(buffer[:n]) != "hello" {
+		t.Errorf("Read result: %q", buffer[:n])
+	}
+	recorded.Close()
+
+	var out bytes.Buffer
+	if err := recorded.Save(&out); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	actions, err := Load(&out)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	replay := New(t)
+	replay.SetExpectedActions(actions...)
+	n, err = replay.Read(buffer)
+	if err != nil {
+		t.Errorf("err should be nil, but %v", err)
+	}
+	if string(buffer[:n]) != "hello" {
+		t.Errorf("Read result: %q", buffer[:n])
+	}
+	replay.Close()
+	errors := replay.Verify()
+	if len(errors) != 0 {
+		t.Errorf("mock shouldn't have any errors, but %d", len(errors))
+	}
+}
+
+func TestRecordRedaction(t *testing.T) {
+	server, client, stop := Pipe()
+	defer stop()
+
+	recorded := Record(client)
+	recorded.SetOptions(RecordOptions{
+		RedactWrite: func(data []byte) []byte {
+			return []byte("REDACTED")
+		},
+	})
+
+	buffer := make([]byte, 100)
+	go server.Read(buffer)
+
+	recorded.Write([]byte("secret-token"))
+
+	actions := recorded.Recorded()
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 recorded action, got %d", len(actions))
+	}
+	write, ok := actions[0].(*writeAction)
+	if !ok {
+		t.Fatalf("expected a write action, got %T", actions[0])
+	}
+	if string(write.data) != "REDACTED" {
+		t.Errorf("redacted data: %q", write.data)
+	}
+}